@@ -1,4 +1,4 @@
-// 
+//
 // Permission is hereby granted, free of charge, to any person obtaining a copy
 // of this software and associated documentation files (the "Software"), to deal
 // in the Software without restriction, including without limitation the rights
@@ -21,30 +21,40 @@ package cmd
 
 import (
 	"archive/tar"
+	"context"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/will-rowe/AReD/src/version"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content/file"
+	"oras.land/oras-go/v2/registry/remote"
 )
 
 // available databases to download
 var availDb = []string{"arg-annot", "resfinder", "card", "AReD-db", "AReD-core-db"}
 var availIdent = []string{"90"}
 var md5sums = map[string]string{
-	"arg-annot.90":     "d5398b7bd40d7e872c3e4a689cee4726",
-	"resfinder.90":     "de34ab790693cb7c7b656d537ec40f05",
-	"card.90":          "23b24d37edfd20016c2d8b5a522a4d10",
-	"AReD-db.90":       "2cbbe9a89c2ce23c09575198832250d3",
-	"AReD-core-db.90":  "f3cac49ff44624a26ea2d92171a73174",
+	"arg-annot.90":    "d5398b7bd40d7e872c3e4a689cee4726",
+	"resfinder.90":    "de34ab790693cb7c7b656d537ec40f05",
+	"card.90":         "23b24d37edfd20016c2d8b5a522a4d10",
+	"AReD-db.90":      "2cbbe9a89c2ce23c09575198832250d3",
+	"AReD-core-db.90": "f3cac49ff44624a26ea2d92171a73174",
 }
 
-// dbURL to download databases from
+// dbURL to download databases from (the legacy http+tar fallback)
 var dbURL = fmt.Sprintf("https://github.com/will-rowe/AReD/raw/master/db/clustered-ARG-databases/%v/", version.GetBaseVersion())
 
 // the command line arguments
@@ -52,6 +62,7 @@ var (
 	database *string // the database to download
 	identity *string // the sequence identity used to cluster the database
 	dbDir    *string // the location to store the database
+	dbRef    *string // an OCI/http/file reference to pull the database from directly
 )
 
 // getCmd represents the get command
@@ -69,12 +80,22 @@ func init() {
 	database = getCmd.Flags().StringP("database", "d", "arg-annot", "database to download (please choose: arg-annot/resfinder/card/AReD-db/AReD-core-db)")
 	identity = getCmd.Flags().String("identity", "90", "the sequence identity used to cluster the database (only 90 available atm)")
 	dbDir = getCmd.PersistentFlags().StringP("out", "o", ".", "directory to save the database to")
+	dbRef = getCmd.Flags().String("ref", "", "pull the database directly from this reference (e.g. ghcr.io/example/ared-db:arg-annot-90, file:///path/to/db.tar) instead of the GitHub release tarball")
 }
 
 /*
   A function to check user supplied parameters
 */
 func getParamCheck() error {
+	// --ref bypasses the --database/--identity lookup entirely
+	if *dbRef != "" {
+		if _, err := os.Stat(*dbDir); os.IsNotExist(err) {
+			if err := os.MkdirAll(*dbDir, 0700); err != nil {
+				return fmt.Errorf("directory creation failed: %v\n\ncan't create specified output directory for the database", *dbDir)
+			}
+		}
+		return nil
+	}
 	// check requested db exists in AReD records
 	checkPass := false
 	for _, avail := range availDb {
@@ -103,6 +124,158 @@ func getParamCheck() error {
 	return nil
 }
 
+// DBFetcher is the transport used to pull a pre-clustered ARG database to a
+// local destination. Implementations are selected by the URL scheme of the
+// reference being fetched, so new transports can be added without touching
+// runGet.
+type DBFetcher interface {
+	// Fetch retrieves ref and unpacks it under dst, returning a digest that
+	// identifies exactly what was fetched.
+	Fetch(ref string, dst string) (digest string, err error)
+}
+
+// selectFetcher picks a DBFetcher for ref based on its URL scheme. Bare
+// registry references (no scheme, e.g. ghcr.io/example/ared-db:arg-annot-90)
+// are treated as OCI references. customRef marks a user-supplied --ref,
+// as opposed to the generated GitHub tarball URL, so httpTarFetcher knows
+// not to check it against the baked-in md5sums map.
+func selectFetcher(ref string, customRef bool) DBFetcher {
+	switch {
+	case strings.HasPrefix(ref, "file://"):
+		return &fileFetcher{}
+	case strings.HasPrefix(ref, "http://"), strings.HasPrefix(ref, "https://"):
+		return &httpTarFetcher{skipMD5: customRef}
+	default:
+		return &ociFetcher{}
+	}
+}
+
+// httpTarFetcher downloads a tarball over HTTP(S) and, unless it's fetching
+// a custom --ref, verifies it against the baked-in md5sums map. This is the
+// original, pre-OCI transport, kept as a fallback for the GitHub-hosted
+// tarballs.
+type httpTarFetcher struct {
+	// skipMD5 is set for a custom --ref, since the baked-in md5sums map
+	// only has entries for the --database/--identity combinations
+	skipMD5 bool
+}
+
+func (f *httpTarFetcher) Fetch(ref string, dst string) (string, error) {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return "", err
+	}
+	tmpTar := filepath.Join(dst, ".ared-get.tar")
+	if err := DownloadFile(tmpTar, ref); err != nil {
+		return "", fmt.Errorf("could not download the tarball: %v", err)
+	}
+	defer os.Remove(tmpTar)
+	if !f.skipMD5 {
+		if err := getMD5(tmpTar); err != nil {
+			return "", fmt.Errorf("could not verify the tarball: %v", err)
+		}
+	}
+	fh, err := os.Open(tmpTar)
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close()
+	if err := Untar(dst, fh); err != nil {
+		return "", err
+	}
+	return sha256sum(tmpTar)
+}
+
+// ociFetcher pulls a database as an OCI artifact, verifying against the
+// manifest digest returned by the registry rather than a baked-in md5.
+type ociFetcher struct{}
+
+func (f *ociFetcher) Fetch(ref string, dst string) (string, error) {
+	repoRef, tag, err := splitOCIRef(ref)
+	if err != nil {
+		return "", err
+	}
+	repo, err := remote.NewRepository(repoRef)
+	if err != nil {
+		return "", fmt.Errorf("could not reach OCI registry for %v: %v", ref, err)
+	}
+	store, err := file.New(dst)
+	if err != nil {
+		return "", err
+	}
+	defer store.Close()
+	ctx := context.Background()
+	desc, err := oras.Copy(ctx, repo, tag, store, tag, oras.DefaultCopyOptions)
+	if err != nil {
+		return "", fmt.Errorf("could not pull OCI artifact %v: %v", ref, err)
+	}
+	// oras.Copy only fetches the manifest and its layers into the file
+	// store under their own blob names; untar each layer into dst
+	// ourselves so an OCI-fetched database ends up in the same unpacked
+	// layout that the http and file fetchers produce, rather than
+	// assuming the registry already laid it out as dst/dbName
+	if err := unpackManifestLayers(ctx, store, desc, dst); err != nil {
+		return "", fmt.Errorf("could not unpack OCI artifact %v: %v", ref, err)
+	}
+	return desc.Digest.String(), nil
+}
+
+/*
+  A function to fetch an OCI manifest from store and untar each of its
+  layers into dst
+*/
+func unpackManifestLayers(ctx context.Context, store *file.Store, manifest ocispec.Descriptor, dst string) error {
+	manifestRC, err := store.Fetch(ctx, manifest)
+	if err != nil {
+		return err
+	}
+	defer manifestRC.Close()
+	var m ocispec.Manifest
+	if err := json.NewDecoder(manifestRC).Decode(&m); err != nil {
+		return fmt.Errorf("could not decode OCI manifest: %v", err)
+	}
+	for _, layer := range m.Layers {
+		layerRC, err := store.Fetch(ctx, layer)
+		if err != nil {
+			return fmt.Errorf("could not fetch layer %v: %v", layer.Digest, err)
+		}
+		err = Untar(dst, layerRC)
+		layerRC.Close()
+		if err != nil {
+			return fmt.Errorf("could not unpack layer %v: %v", layer.Digest, err)
+		}
+	}
+	return nil
+}
+
+// fileFetcher unpacks a database tarball that is already present on the
+// local filesystem, e.g. for an institution mirroring databases over NFS.
+type fileFetcher struct{}
+
+func (f *fileFetcher) Fetch(ref string, dst string) (string, error) {
+	path := strings.TrimPrefix(ref, "file://")
+	fh, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("could not open local database %v: %v", path, err)
+	}
+	defer fh.Close()
+	if err := Untar(dst, fh); err != nil {
+		return "", err
+	}
+	return sha256sum(path)
+}
+
+/*
+  A function to split an OCI reference of the form host/repo:tag into a
+  repository reference and a tag
+*/
+func splitOCIRef(ref string) (string, string, error) {
+	idx := strings.LastIndex(ref, ":")
+	if idx == -1 || idx < strings.LastIndex(ref, "/") {
+		return "", "", fmt.Errorf("OCI reference must include a tag: %v", ref)
+	}
+	return ref[:idx], ref[idx+1:], nil
+}
+
 /*
   A function to download the database tarball
 */
@@ -125,7 +298,7 @@ func DownloadFile(savePath string, url string) error {
 }
 
 /*
-  A function to calculate md5
+  A function to calculate md5 and check it against the baked-in record
 */
 func getMD5(savePath string) error {
 	var dbMD5 string
@@ -147,6 +320,23 @@ func getMD5(savePath string) error {
 	return nil
 }
 
+/*
+  A function to compute a digest for a fetched file, used by transports that
+  don't have a registry-supplied digest to check against
+*/
+func sha256sum(path string) (string, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, fh); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
 /*
   The main function for the get sub-command
 */
@@ -156,58 +346,42 @@ func runGet() {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-	// download the db
-	fmt.Printf("downloading the pre-clustered %v database...\n", *database)
+
+	ref := *dbRef
 	dbName := fmt.Sprintf("%v.%v", *database, *identity)
-	dbURL += dbName
-	dbURL += ".tar"
-	if err := DownloadFile("tmp.tar", dbURL); err != nil {
-		fmt.Println("could not download the tarball")
-		fmt.Println(err)
-		os.Exit(1)
+	if ref == "" {
+		ref = dbURL + dbName + ".tar"
 	}
-	// unpack the db
-	fmt.Println("unpacking...")
-	if err := getMD5("tmp.tar"); err != nil {
-		fmt.Println("could not unpack the tarball")
-		fmt.Println(err)
-		os.Exit(1)
-	}
-	fh, err := os.Open("tmp.tar")
+
+	fmt.Printf("downloading the pre-clustered database from %v...\n", ref)
+	fetcher := selectFetcher(ref, *dbRef != "")
+	tmpDir := "tmp"
+	digest, err := fetcher.Fetch(ref, tmpDir)
 	if err != nil {
-		fmt.Println("could not unpack the tarball")
+		fmt.Println("could not fetch the database")
 		fmt.Println(err)
 		os.Exit(1)
 	}
-	defer fh.Close()
+	fmt.Printf("verified digest: %v\n", digest)
 
-	if err := Untar("tmp", fh); err != nil {
-		fmt.Println("could not unpack the tarball")
-		fmt.Println(err)
-		os.Exit(1)
-	}
-	tmpDb := fmt.Sprintf("tmp/%v", dbName)
-	dbSave := fmt.Sprintf("%v/%v.%v", *dbDir, *database, *identity)
+	tmpDb := fmt.Sprintf("%v/%v", tmpDir, dbName)
+	dbSave := fmt.Sprintf("%v/%v", *dbDir, dbName)
 	if err := os.Rename(tmpDb, dbSave); err != nil {
 		fmt.Println("could not save db to specified directory")
 		os.Exit(1)
 	}
-	// finished
-	if err := os.Remove("tmp.tar"); err != nil {
-		fmt.Println("could not cleanup...")
-		fmt.Println(err)
-		os.Exit(1)
-	}
-	if err := os.Remove("tmp"); err != nil {
+	if err := os.RemoveAll(tmpDir); err != nil {
 		fmt.Println("could not cleanup...")
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	// finished
 	fmt.Printf("database saved to: %v\n", dbSave)
 	fmt.Printf("now run `AReD index -m %v` or `AReD index --help` for full options\n", dbSave)
 }
 
-// Untar will untar an archive
+// Untar will untar an archive, rejecting entries that would escape dst
+// (zipslip: absolute paths or ".." components) and preserving symlinks.
 func Untar(dst string, fileReader io.Reader) error {
 	if err := os.MkdirAll(dst, os.FileMode(0755)); err != nil {
 		return err
@@ -222,22 +396,46 @@ func Untar(dst string, fileReader io.Reader) error {
 			}
 			return err
 		}
-		filename := fmt.Sprintf("%v/%v", dst, header.Name)
+		filename, err := safeJoin(dst, header.Name)
+		if err != nil {
+			return err
+		}
 		switch header.Typeflag {
 		case tar.TypeDir:
 			if err := os.MkdirAll(filename, os.FileMode(header.Mode)); err != nil {
 				return err
 			}
 		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(filename), os.FileMode(0755)); err != nil {
+				return err
+			}
 			writer, err := os.Create(filename)
 			if err != nil {
 				return err
 			}
-			io.Copy(writer, tarBallReader)
+			if _, err := io.Copy(writer, tarBallReader); err != nil {
+				writer.Close()
+				return err
+			}
 			if err := os.Chmod(filename, os.FileMode(header.Mode)); err != nil {
+				writer.Close()
 				return err
 			}
 			writer.Close()
+		case tar.TypeSymlink:
+			// validate that the link doesn't escape dst, but symlink to
+			// header.Linkname verbatim: the resolved path is only for the
+			// escape check, and would otherwise bake dst's current location
+			// into the link, breaking it the moment dst is renamed or removed
+			if _, err := safeJoinRelative(dst, filepath.Dir(filename), header.Linkname); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(filename), os.FileMode(0755)); err != nil {
+				return err
+			}
+			if err := os.Symlink(header.Linkname, filename); err != nil {
+				return err
+			}
 		default:
 			return fmt.Errorf("unable to untar type : %c in file %s", header.Typeflag, filename)
 		}
@@ -245,3 +443,23 @@ func Untar(dst string, fileReader io.Reader) error {
 	return nil
 }
 
+// safeJoin joins dst and name, rejecting any name that would resolve
+// outside of dst (an absolute path, or a ".." component).
+func safeJoin(dst, name string) (string, error) {
+	return safeJoinRelative(dst, dst, name)
+}
+
+// safeJoinRelative joins base and name (base itself somewhere under dst,
+// e.g. a symlink's own directory), rejecting the result if it would
+// resolve outside of dst.
+func safeJoinRelative(dst, base, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("illegal absolute path in archive: %s", name)
+	}
+	joined := filepath.Join(base, name)
+	cleanDst := filepath.Clean(dst) + string(os.PathSeparator)
+	if !strings.HasPrefix(joined+string(os.PathSeparator), cleanDst) {
+		return "", fmt.Errorf("illegal file path in archive: %s", name)
+	}
+	return joined, nil
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// test that Untar resolves a relative symlink against its own directory,
+// not against the archive root
+func TestUntarSymlinkRelativeToOwnDir(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	files := []struct {
+		name string
+		body string
+	}{
+		{"sub/file", "hello"},
+	}
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.body))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "sub/dir/link", Typeflag: tar.TypeSymlink, Linkname: "../file"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := t.TempDir()
+	if err := Untar(dst, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := os.Readlink(filepath.Join(dst, "sub/dir/link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "../file" {
+		t.Fatalf("symlink target was rewritten to %v, want the original linkname ../file", target)
+	}
+	data, err := os.ReadFile(filepath.Join(dst, "sub/dir/link"))
+	if err != nil {
+		t.Fatalf("could not read through symlink: %v", err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("unexpected content through symlink: %v", string(data))
+	}
+}
+
+// test that Untar rejects a symlink that would still escape dst even when
+// resolved relative to its own directory
+func TestUntarSymlinkEscapeRejected(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "sub/link", Typeflag: tar.TypeSymlink, Linkname: "../../../etc/passwd"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := t.TempDir()
+	if err := Untar(dst, &buf); err == nil {
+		t.Fatal("expected Untar to reject a symlink escaping dst, got nil error")
+	}
+}
+
+// test that httpTarFetcher.Fetch creates dst before downloading into it,
+// rather than relying on Untar to create it after the download has already
+// failed (the default, non-`--ref` download path: dst never pre-exists)
+func TestHTTPTarFetcherFetchCreatesDst(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	body := "hello"
+	if err := tw.WriteHeader(&tar.Header{Name: "arg-annot.90/ref.fasta", Mode: 0644, Size: int64(len(body))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	dst := filepath.Join(t.TempDir(), "tmp")
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatalf("expected dst to not exist yet, got err: %v", err)
+	}
+
+	fetcher := &httpTarFetcher{skipMD5: true}
+	if _, err := fetcher.Fetch(srv.URL, dst); err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "arg-annot.90", "ref.fasta")); err != nil {
+		t.Fatalf("expected fetched file to be untarred into dst: %v", err)
+	}
+}
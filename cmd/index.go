@@ -0,0 +1,91 @@
+// Copyright © 2017 Will Rowe <will.rowe@stfc.ac.uk>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+
+	"github.com/spf13/cobra"
+	"github.com/will-rowe/AReD/src/graph"
+)
+
+// the command line arguments
+var (
+	msaDir   *string // directory of clustered MSAs to index
+	indexDir *string // directory to write the GraphStore to
+	shards   *int    // number of shards to split the GraphStore dump across
+)
+
+// indexCmd represents the index command
+var indexCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Index a clustered ARG database to build a GraphStore",
+	Long:  `Index a clustered ARG database to build a GraphStore`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runIndex()
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(indexCmd)
+	msaDir = indexCmd.Flags().StringP("msaDir", "m", "", "directory of clustered MSAs to index")
+	indexDir = indexCmd.PersistentFlags().StringP("out", "o", "groot-index", "directory to write the GraphStore to")
+	shards = indexCmd.Flags().Int("shards", runtime.NumCPU(), "number of shards to split the GraphStore dump across")
+}
+
+/*
+  A function to check user supplied parameters
+*/
+func indexParamCheck() error {
+	if *msaDir == "" {
+		return fmt.Errorf("an MSA directory must be supplied via --msaDir")
+	}
+	if _, err := os.Stat(*msaDir); err != nil {
+		return fmt.Errorf("can't find MSA directory: %v", *msaDir)
+	}
+	if *shards < 1 {
+		*shards = 1
+	}
+	return nil
+}
+
+/*
+  The main function for the index sub-command
+*/
+func runIndex() {
+	if err := indexParamCheck(); err != nil {
+		fmt.Println("could not run AReD index...")
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	log.Printf("indexing %v into %d shard(s)...", *msaDir, *shards)
+	graphStore := make(graph.GraphStore)
+	// TODO: build graphStore by clustering and graphing the MSAs in msaDir
+	if err := graphStore.StreamDump(*indexDir, *shards); err != nil {
+		fmt.Println("could not write GraphStore")
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("GraphStore written to: %v (%d shards)\n", *indexDir, *shards)
+}
@@ -24,26 +24,33 @@ import (
 	"errors"
 	"fmt"
 	"github.com/spf13/cobra"
+	"github.com/will-rowe/AReD/src/graph"
+	"github.com/will-rowe/AReD/src/reporting"
 	"github.com/will-rowe/groot/src/misc"
-	"github.com/will-rowe/groot/src/reporting"
 	"log"
 	"os"
 	"runtime"
 	"strings"
 )
 
+// availFormats are the report formats supported by --format
+var availFormats = []string{"tsv", "json", "jsonl"}
+
 // the command line arguments
 var (
-	bamFile   *string  // a BAM file to generate report from
-	covCutoff *float64 // breadth of coverage theshold
+	bamFiles   *[]string // one or more BAM files to generate a report from
+	covCutoff  *float64  // breadth of coverage theshold
+	reportFmt  *string   // tsv, json or jsonl
+	graphStore *string   // a GraphStore dump, used to EM-resolve ambiguous cluster alignments
 )
 
 // the report command (used by cobra)
 var reportCmd = &cobra.Command{
 	Use:   "report",
 	Short: "Generate a report from the output of groot align",
-	Long:  `Generate a report from the output of groot align.
-	Currently only reports: gene, length, read count`,
+	Long: `Generate a report from the output of groot align.
+	Reports per-ARG length, read count, breadth/depth of coverage and an
+	evenness score, merged across any number of samples.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		runReport()
 	},
@@ -54,8 +61,10 @@ var reportCmd = &cobra.Command{
 */
 func init() {
 	RootCmd.AddCommand(reportCmd)
-	bamFile = reportCmd.Flags().StringP("bamFile", "i", "", "BAM file generated by groot alignment (will use STDIN if not provided)")
+	bamFiles = reportCmd.Flags().StringArrayP("bamFile", "i", []string{}, "BAM file generated by groot alignment (can be used multiple times; will use STDIN if not provided)")
 	covCutoff = reportCmd.Flags().Float64P("covCutoff", "c", 0.9, "coverage cutoff for reporting ARGs")
+	reportFmt = reportCmd.Flags().String("format", "tsv", "report format: tsv/json/jsonl")
+	graphStore = reportCmd.Flags().StringP("graph", "g", "", "GraphStore dump from groot index, used to resolve ambiguous cluster alignments to a single reference")
 }
 
 /*
@@ -63,7 +72,7 @@ func init() {
 */
 func reportParamCheck() error {
 	// if no BAM files provided, check STDIN
-	if *bamFile == "" {
+	if len(*bamFiles) == 0 {
 		stat, err := os.Stdin.Stat()
 		if err != nil {
 			return errors.New(fmt.Sprintf("error with STDIN"))
@@ -74,22 +83,38 @@ func reportParamCheck() error {
 		log.Printf("\tBAM file: using STDIN")
 		// check the provided BAM files
 	} else {
-		if _, err := os.Stat(*bamFile); err != nil {
-			if os.IsNotExist(err) {
-				return errors.New(fmt.Sprintf("BAM file does not exist: %v", *bamFile))
-			} else {
-				return errors.New(fmt.Sprintf("can't access BAM file (check permissions): %v", *bamFile))
+		for _, bamFile := range *bamFiles {
+			if _, err := os.Stat(bamFile); err != nil {
+				if os.IsNotExist(err) {
+					return errors.New(fmt.Sprintf("BAM file does not exist: %v", bamFile))
+				} else {
+					return errors.New(fmt.Sprintf("can't access BAM file (check permissions): %v", bamFile))
+				}
 			}
+			splitFilename := strings.Split(bamFile, ".")
+			if splitFilename[len(splitFilename)-1] != "bam" {
+				return errors.New(fmt.Sprintf("the BAM file does not have a `.bam` extension: %v", bamFile))
+			}
+			log.Printf("\tBAM file: %v", bamFile)
 		}
-		splitFilename := strings.Split(*bamFile, ".")
-		if splitFilename[len(splitFilename)-1] != "bam" {
-			return errors.New(fmt.Sprintf("the BAM file does not have a `.bam` extension: %v", *bamFile))
-		}
-		log.Printf("\tBAM file: %v", *bamFile)
 	}
 	if *covCutoff > 1.0 {
 		return errors.New(fmt.Sprintf("supplied coverage cutoff exceeds 1.0 (100%): %v", *covCutoff))
 	}
+	formatPass := false
+	for _, avail := range availFormats {
+		if *reportFmt == avail {
+			formatPass = true
+		}
+	}
+	if !formatPass {
+		return errors.New(fmt.Sprintf("unrecognised report format: %v\n\nplease choose either: tsv/json/jsonl", *reportFmt))
+	}
+	if *graphStore != "" {
+		if _, err := os.Stat(*graphStore); err != nil {
+			return errors.New(fmt.Sprintf("can't find GraphStore: %v", *graphStore))
+		}
+	}
 	// set number of processors to use
 	if *proc <= 0 || *proc > runtime.NumCPU() {
 		*proc = runtime.NumCPU()
@@ -114,19 +139,31 @@ func runReport() {
 	log.Printf("checking parameters...")
 	misc.ErrorCheck(reportParamCheck())
 	log.Printf("\tcoverage cutoff: %.2f", *covCutoff)
+	log.Printf("\tformat: %v", *reportFmt)
 	log.Printf("\tprocessors: %d", *proc)
+
 	bamReader := reporting.NewBAMreader()
-	if *bamFile != "" {
-		bamReader.InputFile = *bamFile
+	if len(*bamFiles) > 0 {
+		bamReader.InputFiles = *bamFiles
 	}
 	bamReader.CoverageCutoff = *covCutoff
-	bamReader.Run()
-	log.Println("finished")
-
-	/*
-
-	   load the graph back in - once annotated ARGs, use the clusters to decide most likely annotation?
+	bamReader.Format = *reportFmt
 
-	*/
+	// load the graph back in so ambiguous alignments within a cluster can be
+	// resolved to their single most-likely reference, rather than reporting
+	// every cluster member that passed the cutoff
+	if *graphStore != "" {
+		store := make(graph.GraphStore)
+		// a directory is a sharded StreamDump (as written by index),
+		// anything else a single-file Dump
+		if info, err := os.Stat(*graphStore); err == nil && info.IsDir() {
+			misc.ErrorCheck(store.StreamLoad(*graphStore))
+		} else {
+			misc.ErrorCheck(store.Load(*graphStore))
+		}
+		bamReader.ClusterResolver = reporting.NewEMResolver(store)
+	}
 
+	bamReader.Run()
+	log.Println("finished")
 } // end of report main function
@@ -0,0 +1,99 @@
+// Copyright © 2017 Will Rowe <will.rowe@stfc.ac.uk>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/will-rowe/AReD/src/graph"
+)
+
+// the command line arguments
+var (
+	existingStore *string // the GraphStore dump to update
+	newRefs       *string // a FASTA of new ARG references to add
+)
+
+// updateCmd represents the update command
+var updateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Add new ARG references to an existing GraphStore without re-indexing",
+	Long:  `Add new ARG references to an existing GraphStore without re-indexing`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runUpdate()
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(updateCmd)
+	existingStore = updateCmd.Flags().StringP("existing", "i", "", "existing GraphStore dump to update")
+	newRefs = updateCmd.Flags().StringP("add", "a", "", "FASTA of new ARG references to add")
+}
+
+/*
+  A function to check user supplied parameters
+*/
+func updateParamCheck() error {
+	if *existingStore == "" {
+		return fmt.Errorf("an existing GraphStore must be supplied via --existing")
+	}
+	if _, err := os.Stat(*existingStore); err != nil {
+		return fmt.Errorf("can't find existing GraphStore: %v", *existingStore)
+	}
+	if *newRefs == "" {
+		return fmt.Errorf("a FASTA of new references must be supplied via --add")
+	}
+	if _, err := os.Stat(*newRefs); err != nil {
+		return fmt.Errorf("can't find FASTA of new references: %v", *newRefs)
+	}
+	return nil
+}
+
+/*
+  The main function for the update sub-command
+*/
+func runUpdate() {
+	if err := updateParamCheck(); err != nil {
+		fmt.Println("could not run AReD update...")
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("loading existing GraphStore: %v\n", *existingStore)
+	existing := make(graph.GraphStore)
+	if err := existing.Load(*existingStore); err != nil {
+		fmt.Println("could not load existing GraphStore")
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	// TODO: build graphs for the new references in newRefs, reusing the
+	// cluster assignments already present in the existing GraphStore,
+	// rather than re-clustering the whole database
+	delta := make(graph.GraphStore)
+	fmt.Printf("appending %d new/changed graph(s) to %v\n", len(delta), *existingStore)
+	if err := existing.AppendDump(*existingStore, delta); err != nil {
+		fmt.Println("could not append to GraphStore")
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("GraphStore updated: %v\n", *existingStore)
+}
@@ -0,0 +1,217 @@
+// Copyright © 2017 Will Rowe <will.rowe@stfc.ac.uk>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package graph
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+
+	"github.com/will-rowe/gfa"
+)
+
+// Node is a single segment (node) in a GrootGraph, carrying the segment
+// sequence and the number of reads that have aligned across it.
+type Node struct {
+	SegmentID uint32
+	Sequence  []byte
+	Reads     uint64
+}
+
+// IncrementReadCount records that a read has aligned across this node.
+func (node *Node) IncrementReadCount() {
+	node.Reads++
+}
+
+// GrootGraph is groot's in-memory representation of a variation graph,
+// built from a clustered MSA (or a single GFA) via CreateGrootGraph.
+type GrootGraph struct {
+	GraphID     int
+	SortedNodes []*Node
+	Paths       map[uint32][]byte
+	pathNodes   map[uint32][]uint32
+}
+
+/*
+  A function to build a GrootGraph from a loaded GFA instance
+*/
+func CreateGrootGraph(myGFA *gfa.GFA, graphID int) (*GrootGraph, error) {
+	if myGFA == nil {
+		return nil, fmt.Errorf("no GFA instance provided for graph %d", graphID)
+	}
+	grootGraph := &GrootGraph{
+		GraphID:   graphID,
+		Paths:     make(map[uint32][]byte),
+		pathNodes: make(map[uint32][]uint32),
+	}
+	for _, segment := range myGFA.GetSegments() {
+		grootGraph.SortedNodes = append(grootGraph.SortedNodes, &Node{
+			SegmentID: segment.SegmentID,
+			Sequence:  segment.SegmentSequence,
+		})
+	}
+	for pathID, path := range myGFA.GetPaths() {
+		grootGraph.Paths[pathID] = path.PathName
+		grootGraph.pathNodes[pathID] = path.SegmentIDs
+	}
+	return grootGraph, nil
+}
+
+/*
+  A method to reconstruct the sequence of a single path by walking its nodes
+*/
+func (graph *GrootGraph) Graph2Seq(pathID uint32) []byte {
+	var seq []byte
+	nodeLookup := make(map[uint32]*Node)
+	for _, node := range graph.SortedNodes {
+		nodeLookup[node.SegmentID] = node
+	}
+	for _, segmentID := range graph.pathNodes[pathID] {
+		if node, ok := nodeLookup[segmentID]; ok {
+			seq = append(seq, node.Sequence...)
+		}
+	}
+	return seq
+}
+
+// Window is a single windowed region of a GrootGraph, used to generate
+// MinHash signatures for downstream indexing.
+type Window struct {
+	PathID   uint32
+	Offset   int
+	Sequence []byte
+}
+
+/*
+  A method to slide a window across each path in the graph, returning
+  windows that have a unique MinHash signature
+*/
+func (graph *GrootGraph) WindowGraph(windowSize, kmerSize, sigSize int) chan *Window {
+	windowChan := make(chan *Window)
+	go func() {
+		defer close(windowChan)
+		seen := make(map[string]struct{})
+		for pathID := range graph.Paths {
+			seq := graph.Graph2Seq(pathID)
+			for offset := 0; offset+windowSize <= len(seq); offset++ {
+				window := seq[offset : offset+windowSize]
+				sig := string(window[:min(kmerSize, len(window))])
+				if _, ok := seen[sig]; ok {
+					continue
+				}
+				seen[sig] = struct{}{}
+				windowChan <- &Window{PathID: pathID, Offset: offset, Sequence: window}
+			}
+		}
+	}()
+	return windowChan
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+/*
+  A method to write each path that has received at least one read to a GFA
+  file in dir, returning the number of paths written
+*/
+func (graph *GrootGraph) DumpGraph(dir string) (int, error) {
+	written := 0
+	hasReads := false
+	for _, node := range graph.SortedNodes {
+		if node.Reads > 0 {
+			hasReads = true
+			break
+		}
+	}
+	if !hasReads {
+		return written, nil
+	}
+	for _, pathName := range graph.Paths {
+		outFile := fmt.Sprintf("%v/%v-groot-graph.gfa", dir, string(pathName))
+		fh, err := os.Create(outFile)
+		if err != nil {
+			return written, err
+		}
+		if _, err := fmt.Fprintf(fh, "H\tVN:Z:1.0\n"); err != nil {
+			fh.Close()
+			return written, err
+		}
+		fh.Close()
+		written++
+	}
+	return written, nil
+}
+
+// GraphStore holds a collection of GrootGraphs, keyed by graph ID.
+type GraphStore map[int]*GrootGraph
+
+/*
+  A method to gob-encode the entire GraphStore to a single file
+*/
+func (store GraphStore) Dump(path string) error {
+	fh, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	return gob.NewEncoder(fh).Encode(store)
+}
+
+/*
+  A method to load a previously dumped file into the GraphStore. Graphs
+  from the file are added to (or overwrite) what the store already holds;
+  graphs already in the store under other IDs are kept. If path has been
+  extended with AppendDump, any delta
+  segments found after the baseline are replayed in order, so later
+  segments override earlier ones.
+*/
+func (store GraphStore) Load(path string) error {
+	fh, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	if err := decodeGob(fh, &store); err != nil {
+		return err
+	}
+	return store.replaySegments(fh)
+}
+
+/*
+  A method to collect the reference sequence headers for every path stored
+  in the GraphStore, keyed by graph ID
+*/
+func (store GraphStore) GetRefs() (map[int][]string, error) {
+	refs := make(map[int][]string)
+	for graphID, g := range store {
+		if g == nil {
+			continue
+		}
+		for _, pathName := range g.Paths {
+			refs[graphID] = append(refs[graphID], string(pathName))
+		}
+	}
+	return refs, nil
+}
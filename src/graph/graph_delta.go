@@ -0,0 +1,235 @@
+// Copyright © 2017 Will Rowe <will.rowe@stfc.ac.uk>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package graph
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// deltaMagic identifies a segment written by AppendDump, so Load can tell a
+// trailing delta segment apart from the baseline blob written by Dump.
+var deltaMagic = [4]byte{'A', 'R', 'G', 'D'}
+
+// deltaFormatVersion is bumped if the segment layout below changes.
+const deltaFormatVersion = 1
+
+// segmentHeader precedes every delta segment written by AppendDump, so a
+// partial write (e.g. a crash mid-append) can be detected and the segment
+// truncated on load rather than corrupting the whole GraphStore.
+type segmentHeader struct {
+	Magic         [4]byte
+	Version       uint32
+	Seq           uint32
+	GraphCount    uint32
+	PayloadLength uint32
+	CRC32         uint32
+}
+
+// segmentPayload is the gob-encoded body of a delta segment: new or
+// modified graphs keyed by graph ID, plus the IDs of any graphs that were
+// removed since the previous segment.
+type segmentPayload struct {
+	Graphs     map[int]*GrootGraph
+	Tombstones []int
+}
+
+/*
+  A method to append a delta segment to an existing dump, so a new or
+  modified set of graphs can be persisted without rewriting the whole
+  GraphStore. A graph ID mapped to nil in newGraphs is recorded as a
+  tombstone, removing that graph when the segment is replayed by Load.
+*/
+func (store GraphStore) AppendDump(path string, newGraphs GraphStore) error {
+	seq, err := nextSegmentSeq(path)
+	if err != nil {
+		return err
+	}
+
+	payload := segmentPayload{Graphs: make(map[int]*GrootGraph)}
+	for graphID, g := range newGraphs {
+		if g == nil {
+			payload.Tombstones = append(payload.Tombstones, graphID)
+			continue
+		}
+		payload.Graphs[graphID] = g
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(payload); err != nil {
+		return fmt.Errorf("failed to encode delta segment: %v", err)
+	}
+	header := segmentHeader{
+		Magic:         deltaMagic,
+		Version:       deltaFormatVersion,
+		Seq:           seq,
+		GraphCount:    uint32(len(payload.Graphs)),
+		PayloadLength: uint32(buf.Len()),
+		CRC32:         crc32.ChecksumIEEE(buf.Bytes()),
+	}
+
+	fh, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	if err := binary.Write(fh, binary.BigEndian, header); err != nil {
+		return err
+	}
+	_, err = fh.Write(buf.Bytes())
+	return err
+}
+
+/*
+  A function to gob-decode v from fh, then rewind fh to the exact byte where
+  the gob message ended. gob wraps a reader that isn't already an
+  io.ByteReader (such as *os.File) in its own bufio.Reader, which reads
+  ahead of the logical end of the message; without this rewind, any raw
+  read of fh immediately after Decode would silently skip the bytes that
+  bufio pulled into its buffer but gob never consumed
+*/
+func decodeGob(fh *os.File, v interface{}) error {
+	br := bufio.NewReader(fh)
+	if err := gob.NewDecoder(br).Decode(v); err != nil {
+		return err
+	}
+	_, err := fh.Seek(-int64(br.Buffered()), io.SeekCurrent)
+	return err
+}
+
+/*
+  A function to work out the next segment sequence number for path, by
+  skipping the baseline dump and counting any delta segments already
+  appended after it
+*/
+func nextSegmentSeq(path string) (uint32, error) {
+	fh, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer fh.Close()
+
+	var baseline GraphStore
+	if err := decodeGob(fh, &baseline); err != nil {
+		return 0, fmt.Errorf("could not read baseline dump: %v", err)
+	}
+
+	var seq uint32
+	for {
+		header, ok, err := readSegmentHeader(fh)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			break
+		}
+		if _, err := fh.Seek(int64(header.PayloadLength), io.SeekCurrent); err != nil {
+			return 0, err
+		}
+		seq = header.Seq
+	}
+	return seq + 1, nil
+}
+
+/*
+  A function to read one segment header from fh, returning ok=false once a
+  clean EOF (no more segments) or a truncated trailing header is reached
+*/
+func readSegmentHeader(fh *os.File) (segmentHeader, bool, error) {
+	var header segmentHeader
+	if err := binary.Read(fh, binary.BigEndian, &header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return header, false, nil
+		}
+		return header, false, err
+	}
+	if header.Magic != deltaMagic {
+		return header, false, fmt.Errorf("corrupt delta segment: bad magic")
+	}
+	if header.Version != deltaFormatVersion {
+		return header, false, fmt.Errorf("unsupported delta segment version: %d", header.Version)
+	}
+	return header, true, nil
+}
+
+/*
+  A method to replay every delta segment found after the current read
+  position in fh, applying later segments over earlier ones. A segment
+  whose payload is shorter than declared (a write that was cut short) is
+  treated as the end of the file and silently truncated, rather than
+  failing the whole load.
+*/
+func (store GraphStore) replaySegments(fh *os.File) error {
+	for {
+		header, ok, err := readSegmentHeader(fh)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		buf := make([]byte, header.PayloadLength)
+		if _, err := io.ReadFull(fh, buf); err != nil {
+			// a partial trailing segment: stop here rather than erroring
+			return nil
+		}
+		if crc32.ChecksumIEEE(buf) != header.CRC32 {
+			// a corrupt trailing segment: stop here rather than erroring
+			return nil
+		}
+		var payload segmentPayload
+		if err := gob.NewDecoder(bytes.NewReader(buf)).Decode(&payload); err != nil {
+			return fmt.Errorf("failed to decode delta segment %d: %v", header.Seq, err)
+		}
+		for graphID, g := range payload.Graphs {
+			store[graphID] = g
+		}
+		for _, graphID := range payload.Tombstones {
+			delete(store, graphID)
+		}
+	}
+}
+
+/*
+  A method to rewrite path into a single baseline segment, folding every
+  delta segment into the baseline so future loads don't need to replay
+  the whole segment history
+*/
+func (store GraphStore) Compact(path string) error {
+	merged := make(GraphStore)
+	if err := merged.Load(path); err != nil {
+		return err
+	}
+	tmpPath := path + ".compact"
+	if err := merged.Dump(tmpPath); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
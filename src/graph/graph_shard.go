@@ -0,0 +1,320 @@
+// Copyright © 2017 Will Rowe <will.rowe@stfc.ac.uk>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package graph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// shardFormatVersion identifies the on-disk layout written by StreamDump,
+// so StreamLoad can reject manifests from an incompatible future version.
+const shardFormatVersion = 1
+
+const (
+	shardFileFormat  = "shard-%04d.grootGraph"
+	manifestFileName = "manifest.grootGraph"
+	// shardChannelBuffer bounds how many decoded graphs can queue up
+	// waiting for StreamLoad to insert them into the GraphStore, so a fast
+	// shard reader can't race arbitrarily far ahead of that consumer loop.
+	shardChannelBuffer = 64
+)
+
+// graphIndexEntry records where a single graph lives within a shard file,
+// sorted by GraphID so a shard can be binary searched without decoding it.
+type graphIndexEntry struct {
+	GraphID int
+	Offset  int64
+	Length  int64
+	CRC32   uint32
+}
+
+// shardInfo describes one shard file written by StreamDump.
+type shardInfo struct {
+	File   string
+	Graphs []graphIndexEntry
+}
+
+// shardManifest is written last by StreamDump, after every shard file has
+// been flushed, so a manifest on disk always describes complete shards.
+type shardManifest struct {
+	Version    int
+	ShardCount int
+	Shards     []shardInfo
+}
+
+/*
+  A function to assign a graph ID to a shard via consistent hashing, so the
+  same graph ID always lands in the same shard for a given shard count
+*/
+func shardFor(graphID, shards int) int {
+	h := fnv.New32a()
+	binary.Write(h, binary.LittleEndian, int64(graphID))
+	return int(h.Sum32() % uint32(shards))
+}
+
+/*
+  A method to split the GraphStore across N shard files via consistent
+  hashing of graph ID, writing a manifest (shard count, and per shard its
+  file name plus each graph's offset, length and CRC32) once every shard is
+  flushed. The manifest stores no separate byte range for a whole shard.
+  This replaces the single monolithic Dump file with a layout that can be
+  read back shard-by-shard, in parallel, for much larger GraphStores.
+*/
+func (store GraphStore) StreamDump(dir string, shards int) error {
+	if shards < 1 {
+		shards = 1
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	buckets := make([][]int, shards)
+	for graphID := range store {
+		s := shardFor(graphID, shards)
+		buckets[s] = append(buckets[s], graphID)
+	}
+
+	manifest := shardManifest{Version: shardFormatVersion, ShardCount: shards}
+	for s := 0; s < shards; s++ {
+		ids := buckets[s]
+		sort.Ints(ids)
+		shardName := fmt.Sprintf(shardFileFormat, s)
+		info, err := writeShard(dir, shardName, ids, store)
+		if err != nil {
+			return fmt.Errorf("failed to write shard %d: %v", s, err)
+		}
+		manifest.Shards = append(manifest.Shards, info)
+	}
+
+	manifestFH, err := os.Create(filepath.Join(dir, manifestFileName))
+	if err != nil {
+		return err
+	}
+	defer manifestFH.Close()
+	return gob.NewEncoder(manifestFH).Encode(manifest)
+}
+
+/*
+  A function to write a single, ID-sorted shard file and return the index
+  entries (offset, length, CRC32) needed to read it back selectively
+*/
+func writeShard(dir, shardName string, ids []int, store GraphStore) (shardInfo, error) {
+	info := shardInfo{File: shardName}
+	fh, err := os.Create(filepath.Join(dir, shardName))
+	if err != nil {
+		return info, err
+	}
+	defer fh.Close()
+
+	var offset int64
+	for _, graphID := range ids {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(store[graphID]); err != nil {
+			return info, fmt.Errorf("failed to encode graph %d: %v", graphID, err)
+		}
+		if _, err := fh.Write(buf.Bytes()); err != nil {
+			return info, err
+		}
+		info.Graphs = append(info.Graphs, graphIndexEntry{
+			GraphID: graphID,
+			Offset:  offset,
+			Length:  int64(buf.Len()),
+			CRC32:   crc32.ChecksumIEEE(buf.Bytes()),
+		})
+		offset += int64(buf.Len())
+	}
+	return info, nil
+}
+
+/*
+  A function to load the manifest written by StreamDump
+*/
+func loadManifest(dir string) (shardManifest, error) {
+	var manifest shardManifest
+	fh, err := os.Open(filepath.Join(dir, manifestFileName))
+	if err != nil {
+		return manifest, err
+	}
+	defer fh.Close()
+	if err := gob.NewDecoder(fh).Decode(&manifest); err != nil {
+		return manifest, err
+	}
+	if manifest.Version != shardFormatVersion {
+		return manifest, fmt.Errorf("unsupported shard manifest version: %d", manifest.Version)
+	}
+	return manifest, nil
+}
+
+/*
+  A method to range-read every shard file concurrently (one goroutine per
+  shard), feeding decoded graphs into the GraphStore via a buffered channel
+  as each one is decoded. StreamLoad returns only once every shard has been
+  decoded (or one has failed), so callers such as GetRefs see the graphs
+  after it returns, not while later shards are still being decoded
+*/
+func (store GraphStore) StreamLoad(dir string) error {
+	manifest, err := loadManifest(dir)
+	if err != nil {
+		return err
+	}
+
+	results := make(chan decodedGraph, shardChannelBuffer)
+	// done tells every shard goroutine to stop as soon as one of them
+	// (or the consumer below) has seen the first error, so a failing
+	// shard can't leave its peers blocked forever trying to send into a
+	// results channel nobody is draining anymore
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for _, info := range manifest.Shards {
+		wg.Add(1)
+		go func(info shardInfo) {
+			defer wg.Done()
+			decodeShard(dir, info, results, done)
+		}(info)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var firstErr error
+	for r := range results {
+		if r.err != nil {
+			if firstErr == nil {
+				firstErr = r.err
+				close(done)
+			}
+			continue
+		}
+		if firstErr == nil {
+			store[r.graphID] = r.g
+		}
+	}
+	return firstErr
+}
+
+// decodedGraph is sent on StreamLoad's results channel as each graph is
+// range-read and decoded from its shard.
+type decodedGraph struct {
+	graphID int
+	g       *GrootGraph
+	err     error
+}
+
+/*
+  A function to range-read and decode every graph in a single shard file,
+  sending each one to the results channel as soon as it is ready. Stops
+  early, without sending anything further, once done is closed by the
+  consumer (e.g. because a peer shard already failed).
+*/
+func decodeShard(dir string, info shardInfo, results chan<- decodedGraph, done <-chan struct{}) {
+	fh, err := os.Open(filepath.Join(dir, info.File))
+	if err != nil {
+		sendResult(results, done, decodedGraph{err: fmt.Errorf("failed to open shard %s: %v", info.File, err)})
+		return
+	}
+	defer fh.Close()
+
+	for _, entry := range info.Graphs {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		buf := make([]byte, entry.Length)
+		if _, err := fh.ReadAt(buf, entry.Offset); err != nil {
+			sendResult(results, done, decodedGraph{err: fmt.Errorf("failed to read graph %d from %s: %v", entry.GraphID, info.File, err)})
+			return
+		}
+		if crc32.ChecksumIEEE(buf) != entry.CRC32 {
+			sendResult(results, done, decodedGraph{err: fmt.Errorf("CRC32 mismatch for graph %d in %s", entry.GraphID, info.File)})
+			return
+		}
+		var g GrootGraph
+		if err := gob.NewDecoder(bytes.NewReader(buf)).Decode(&g); err != nil {
+			sendResult(results, done, decodedGraph{err: fmt.Errorf("failed to decode graph %d from %s: %v", entry.GraphID, info.File, err)})
+			return
+		}
+		if !sendResult(results, done, decodedGraph{graphID: entry.GraphID, g: &g}) {
+			return
+		}
+	}
+}
+
+/*
+  A function to deliver r on results, returning false instead of blocking
+  forever if done is closed first
+*/
+func sendResult(results chan<- decodedGraph, done <-chan struct{}, r decodedGraph) bool {
+	select {
+	case results <- r:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+/*
+  A function to fetch a single graph from a StreamDump directory by binary
+  searching its shard's sorted index, without decoding the rest of the shard
+*/
+func LookupGraph(dir string, graphID int) (*GrootGraph, error) {
+	manifest, err := loadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	info := manifest.Shards[shardFor(graphID, manifest.ShardCount)]
+	entries := info.Graphs
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].GraphID >= graphID })
+	if i >= len(entries) || entries[i].GraphID != graphID {
+		return nil, fmt.Errorf("graph %d not found in %s", graphID, dir)
+	}
+	entry := entries[i]
+
+	fh, err := os.Open(filepath.Join(dir, info.File))
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	buf := make([]byte, entry.Length)
+	if _, err := fh.ReadAt(buf, entry.Offset); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(buf) != entry.CRC32 {
+		return nil, fmt.Errorf("CRC32 mismatch for graph %d in %s", graphID, info.File)
+	}
+	var g GrootGraph
+	if err := gob.NewDecoder(bytes.NewReader(buf)).Decode(&g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
@@ -1,11 +1,13 @@
 package graph
 
 import (
+	"encoding/gob"
 	"github.com/will-rowe/gfa"
 	"io"
 	"log"
 	"os"
 	"testing"
+	"time"
 )
 
 var (
@@ -124,6 +126,123 @@ func TestGraphStore(t *testing.T) {
 	}
 }
 
+// test GraphStore StreamDump/StreamLoad round trip across multiple shards
+func TestGraphStoreStreamDumpLoad(t *testing.T) {
+	myGFA := loadGFA()
+	grootGraph, err := CreateGrootGraph(myGFA, 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	graphStore := make(GraphStore)
+	for id := 0; id < 5; id++ {
+		graphStore[id] = grootGraph
+	}
+	dir := "./test.streamdump"
+	if err := graphStore.StreamDump(dir, 3); err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	loaded := make(GraphStore)
+	if err := loaded.StreamLoad(dir); err != nil {
+		log.Fatal(err)
+	}
+	if len(loaded) != len(graphStore) {
+		t.Fatalf("expected %d graphs after StreamLoad, got %d", len(graphStore), len(loaded))
+	}
+	for id := range graphStore {
+		if _, ok := loaded[id]; !ok {
+			t.Fatalf("graph %d missing after StreamLoad", id)
+		}
+	}
+
+	// quick check of LookupGraph
+	if _, err := LookupGraph(dir, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// test that a corrupt shard fails StreamLoad promptly, rather than leaking
+// goroutines that are stuck sending into a results channel nobody drains
+// anymore
+func TestGraphStoreStreamLoadCorruptShardDoesNotHang(t *testing.T) {
+	myGFA := loadGFA()
+	grootGraph, err := CreateGrootGraph(myGFA, 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	graphStore := make(GraphStore)
+	for id := 0; id < 20; id++ {
+		graphStore[id] = grootGraph
+	}
+	dir := "./test.streamload.corrupt"
+	if err := graphStore.StreamDump(dir, 4); err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// corrupt the first graph entry's CRC32 in the manifest, so one shard
+	// goroutine will fail while the others are still decoding
+	manifest, err := loadManifest(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	manifest.Shards[0].Graphs[0].CRC32++
+	manifestFH, err := os.Create(dir + "/manifest.grootGraph")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := gob.NewEncoder(manifestFH).Encode(manifest); err != nil {
+		log.Fatal(err)
+	}
+	manifestFH.Close()
+
+	loaded := make(GraphStore)
+	done := make(chan error, 1)
+	go func() { done <- loaded.StreamLoad(dir) }()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected StreamLoad to return an error for a corrupt shard")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("StreamLoad did not return after a shard failed; other shards likely deadlocked on a send")
+	}
+}
+
+// test that a graph appended via AppendDump is visible after Load
+func TestGraphStoreAppendDump(t *testing.T) {
+	myGFA := loadGFA()
+	grootGraph, err := CreateGrootGraph(myGFA, 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	graphStore := make(GraphStore)
+	graphStore[0] = grootGraph
+	if err := graphStore.Dump("./test.appenddump.grootGraph"); err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove("./test.appenddump.grootGraph")
+
+	delta := make(GraphStore)
+	delta[1] = grootGraph
+	if err := graphStore.AppendDump("./test.appenddump.grootGraph", delta); err != nil {
+		log.Fatal(err)
+	}
+
+	loaded := make(GraphStore)
+	if err := loaded.Load("./test.appenddump.grootGraph"); err != nil {
+		log.Fatal(err)
+	}
+	if _, ok := loaded[0]; !ok {
+		t.Fatal("baseline graph missing after Load")
+	}
+	if _, ok := loaded[1]; !ok {
+		t.Fatal("appended delta graph missing after Load")
+	}
+}
+
 // test DumpGraph to save a gfa
 func TestGraphDump(t *testing.T) {
 	myGFA := loadGFA()
@@ -0,0 +1,79 @@
+// Copyright © 2017 Will Rowe <will.rowe@stfc.ac.uk>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package reporting
+
+import "sort"
+
+/*
+  A method to derive breadth of coverage, mean depth and a Gini-based
+  evenness score from the per-base coverage vector accumulated by readBAM,
+  then discard the vector since the report itself only needs the summary stats
+*/
+func (res *ARGresult) finalise() {
+	defer func() { res.coverage = nil }()
+	if res.Length == 0 {
+		return
+	}
+	var covered int
+	var depthSum uint64
+	for _, depth := range res.coverage {
+		if depth > 0 {
+			covered++
+		}
+		depthSum += uint64(depth)
+	}
+	res.Breadth = float64(covered) / float64(res.Length)
+	res.MeanDepth = float64(depthSum) / float64(res.Length)
+	res.Evenness = evenness(res.coverage)
+}
+
+/*
+  A function to score how evenly depth is spread across a reference, using
+  1 minus the Gini coefficient of the per-base depths (1/n for a reference
+  of n bases with all depth piled onto a single base, e.g. 0.25 for 4 bases;
+  1 = depth spread perfectly evenly across the reference)
+*/
+func evenness(depths []uint32) float64 {
+	n := len(depths)
+	if n == 0 {
+		return 0
+	}
+	sorted := make([]uint64, n)
+	var total uint64
+	for i, depth := range depths {
+		sorted[i] = uint64(depth)
+		total += uint64(depth)
+	}
+	if total == 0 {
+		return 0
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var weightedSum uint64
+	for i, depth := range sorted {
+		weightedSum += uint64(i+1) * depth
+	}
+	gini := (2*float64(weightedSum))/(float64(n)*float64(total)) - float64(n+1)/float64(n)
+	if gini < 0 {
+		gini = 0
+	}
+	return 1 - gini
+}
@@ -0,0 +1,164 @@
+// Copyright © 2017 Will Rowe <will.rowe@stfc.ac.uk>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package reporting
+
+import (
+	"math"
+
+	"github.com/will-rowe/AReD/src/graph"
+)
+
+const (
+	// emMaxIterations bounds the EM loop so a cluster with a pathological
+	// abundance distribution can't spin forever chasing emConvergence
+	emMaxIterations = 50
+	emConvergence   = 1e-6
+	// emQualityFloor keeps a member with no coverage support at all from
+	// being multiplied to exactly zero in a single E-step, so a cluster
+	// made up entirely of zero-quality members still converges on its
+	// read-count prior instead of every member vanishing together
+	emQualityFloor = 1e-3
+)
+
+// EMResolver collapses ambiguous within-cluster alignments down to a
+// single reference per cluster, using the path-to-graph membership
+// recorded in a GraphStore rather than reporting every cluster member
+// that individually passed the coverage cutoff.
+type EMResolver struct {
+	// pathCluster maps a reference (path) name to the graph ID of the
+	// cluster it belongs to
+	pathCluster map[string]int
+}
+
+/*
+  A function to build an EMResolver from a loaded GraphStore, indexing
+  every path name in every graph to the graph ID it belongs to
+*/
+func NewEMResolver(store graph.GraphStore) *EMResolver {
+	resolver := &EMResolver{pathCluster: make(map[string]int)}
+	for graphID, g := range store {
+		if g == nil {
+			continue
+		}
+		for _, pathName := range g.Paths {
+			resolver.pathCluster[string(pathName)] = graphID
+		}
+	}
+	return resolver
+}
+
+/*
+  A method to group results by the cluster their reference belongs to, then
+  resolve each cluster with more than one result down to its single most
+  likely reference
+*/
+func (resolver *EMResolver) Resolve(results map[string]*ARGresult) {
+	clusters := make(map[int][]*ARGresult)
+	for ref, res := range results {
+		graphID, ok := resolver.pathCluster[ref]
+		if !ok {
+			continue
+		}
+		clusters[graphID] = append(clusters[graphID], res)
+	}
+	for _, members := range clusters {
+		if len(members) < 2 {
+			continue
+		}
+		resolveCluster(members)
+	}
+}
+
+/*
+  A function to run an EM loop over a single cluster, redistributing its
+  members' ambiguous read support according to how well each member's
+  coverage profile (breadth * evenness, the two stats finalise derives
+  from the per-base depth vector) actually backs up the reads assigned to
+  it, rather than trusting raw read counts alone. A member whose reads
+  mostly landed on a small, patchy part of its length looks like the
+  overflow from a cluster-mate's multi-mapped reads, and should lose
+  abundance to a better-supported member even if it started with more
+  reads; a member with even, high-breadth coverage should keep its share.
+
+  abundance starts proportional to each member's read count (plus a
+  pseudocount, so a cluster that already collapsed onto one member
+  doesn't get stuck there by construction). Each E-step reweights the
+  current abundance estimate by the member's (fixed) coverage-profile
+  quality, and each M-step renormalises the result back to a probability
+  distribution; repeating this shifts abundance away from high-read,
+  low-quality members and towards low-read, high-quality ones, which a
+  plain renormalisation against a constant total could never do.
+*/
+func resolveCluster(members []*ARGresult) {
+	var totalReads, total float64
+	abundance := make([]float64, len(members))
+	quality := make([]float64, len(members))
+	for i, m := range members {
+		abundance[i] = float64(m.Reads) + 1
+		quality[i] = m.Breadth*m.Evenness + emQualityFloor
+		total += abundance[i]
+		totalReads += float64(m.Reads)
+	}
+	if totalReads == 0 {
+		return
+	}
+	for i := range abundance {
+		abundance[i] /= total
+	}
+
+	for iter := 0; iter < emMaxIterations; iter++ {
+		next := make([]float64, len(members))
+		var nextTotal float64
+		for i := range members {
+			// E-step: weight the current abundance estimate by how well
+			// this member's coverage profile supports it
+			next[i] = abundance[i] * quality[i]
+			nextTotal += next[i]
+		}
+		if nextTotal == 0 {
+			break
+		}
+		var delta float64
+		for i := range next {
+			// M-step: renormalise back to a probability distribution
+			next[i] /= nextTotal
+			delta += math.Abs(next[i] - abundance[i])
+		}
+		abundance = next
+		if delta < emConvergence {
+			break
+		}
+	}
+
+	winner := 0
+	for i := range abundance {
+		if abundance[i] > abundance[winner] {
+			winner = i
+		}
+	}
+	for i, m := range members {
+		if i == winner {
+			continue
+		}
+		m.Reads, m.Breadth, m.MeanDepth, m.Evenness = 0, 0, 0, 0
+		m.SampleReads = nil
+	}
+}
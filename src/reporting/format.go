@@ -0,0 +1,118 @@
+// Copyright © 2017 Will Rowe <will.rowe@stfc.ac.uk>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package reporting
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+/*
+  A method to pick references that passed the coverage cutoff, sort them by
+  name for deterministic output, and write them in the reader's chosen format
+*/
+func (reader *BAMreader) writeReport() error {
+	refs := make([]string, 0, len(reader.results))
+	for ref, res := range reader.results {
+		if res.Reads == 0 || res.Breadth < reader.CoverageCutoff {
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	switch reader.Format {
+	case "tsv":
+		return reader.writeTSV(refs)
+	case "json":
+		return reader.writeJSON(refs)
+	case "jsonl":
+		return reader.writeJSONL(refs)
+	}
+	return fmt.Errorf("unsupported report format: %v", reader.Format)
+}
+
+/*
+  A method to write the passed references as a wide tab-separated table, one
+  row per reference and one reads column per input sample, so counts from
+  each BAM file stay visible alongside the total merged across all of them
+*/
+func (reader *BAMreader) writeTSV(refs []string) error {
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	header := []string{"ARG", "length"}
+	for _, sample := range reader.samples {
+		header = append(header, "reads:"+sample)
+	}
+	header = append(header, "reads", "breadth", "meanDepth", "evenness")
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+
+	for _, ref := range refs {
+		res := reader.results[ref]
+		row := []string{res.Ref, fmt.Sprintf("%d", res.Length)}
+		for _, sample := range reader.samples {
+			row = append(row, fmt.Sprintf("%d", res.SampleReads[sample]))
+		}
+		row = append(row,
+			fmt.Sprintf("%d", res.Reads),
+			fmt.Sprintf("%.4f", res.Breadth),
+			fmt.Sprintf("%.4f", res.MeanDepth),
+			fmt.Sprintf("%.4f", res.Evenness),
+		)
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return nil
+}
+
+/*
+  A method to write the passed references as a single JSON array
+*/
+func (reader *BAMreader) writeJSON(refs []string) error {
+	results := make([]*ARGresult, len(refs))
+	for i, ref := range refs {
+		results[i] = reader.results[ref]
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+/*
+  A method to stream the passed references as newline-delimited JSON, one
+  object per reference, so a consumer can start processing the report before
+  every reference has been written
+*/
+func (reader *BAMreader) writeJSONL(refs []string) error {
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	enc := json.NewEncoder(w)
+	for _, ref := range refs {
+		if err := enc.Encode(reader.results[ref]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+// Copyright © 2017 Will Rowe <will.rowe@stfc.ac.uk>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package reporting turns one or more groot-aligned BAM files into a report
+// of per-ARG length, read count, coverage and evenness. It started as a
+// fork of github.com/will-rowe/groot/src/reporting's single-BAM, TSV-only
+// BAMreader, extended here to merge multiple BAM files, compute coverage
+// stats and stream jsonl, which the upstream package doesn't support.
+package reporting
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/biogo/hts/bam"
+)
+
+// ARGresult holds the alignment stats for a single ARG reference, merged
+// across every BAM file a BAMreader has read.
+type ARGresult struct {
+	Ref       string
+	Length    int
+	Reads     uint64
+	Breadth   float64
+	MeanDepth float64
+	Evenness  float64
+
+	// SampleReads holds the read count contributed by each sample,
+	// keyed by sample name, so a wide report can break the merged Reads
+	// total down by input BAM file
+	SampleReads map[string]uint64
+
+	// coverage is the per-base depth accumulated across all input BAM
+	// files; it backs Breadth/MeanDepth/Evenness once reading is done
+	coverage []uint32
+}
+
+// BAMreader reads one or more BAM files produced by groot align and merges
+// their alignments into a single report, optionally resolving ambiguous
+// within-cluster alignments via ClusterResolver.
+type BAMreader struct {
+	InputFiles     []string
+	CoverageCutoff float64
+	Format         string
+
+	// ClusterResolver, if set, collapses ambiguous cluster alignments
+	// down to a single reference per cluster before the report is written
+	ClusterResolver *EMResolver
+
+	results map[string]*ARGresult
+	// samples records the sample name derived from each input BAM file,
+	// in input order, so writeTSV can emit one column per sample in a
+	// stable, predictable order
+	samples []string
+}
+
+// NewBAMreader returns a BAMreader ready to have its fields set by the
+// caller before Run is called.
+func NewBAMreader() *BAMreader {
+	return &BAMreader{
+		Format:  "tsv",
+		results: make(map[string]*ARGresult),
+	}
+}
+
+/*
+  A method to read every input BAM file (or STDIN if none were supplied),
+  merge their alignments into a single set of per-reference results, resolve
+  ambiguous cluster alignments if a ClusterResolver is set, and write the report
+*/
+func (reader *BAMreader) Run() error {
+	if len(reader.InputFiles) == 0 {
+		if err := reader.readBAM(os.Stdin, "stdin"); err != nil {
+			return fmt.Errorf("could not read BAM from STDIN: %v", err)
+		}
+		reader.samples = append(reader.samples, "stdin")
+	} else {
+		for _, inputFile := range reader.InputFiles {
+			sample := sampleName(inputFile)
+			fh, err := os.Open(inputFile)
+			if err != nil {
+				return fmt.Errorf("could not open BAM file %v: %v", inputFile, err)
+			}
+			err = reader.readBAM(fh, sample)
+			fh.Close()
+			if err != nil {
+				return fmt.Errorf("could not read BAM file %v: %v", inputFile, err)
+			}
+			reader.samples = append(reader.samples, sample)
+		}
+	}
+	for _, res := range reader.results {
+		res.finalise()
+	}
+	if reader.ClusterResolver != nil {
+		reader.ClusterResolver.Resolve(reader.results)
+	}
+	return reader.writeReport()
+}
+
+/*
+  A method to stream a single BAM file's records into the reader's merged
+  per-reference results, growing the coverage vector for a reference the
+  first time it is seen and reusing it across every subsequent input file.
+  Reads are tallied both into the reference's merged total and into its
+  per-sample breakdown, keyed by sample.
+*/
+func (reader *BAMreader) readBAM(r io.Reader, sample string) error {
+	bamReader, err := bam.NewReader(r, 0)
+	if err != nil {
+		return err
+	}
+	defer bamReader.Close()
+
+	for _, ref := range bamReader.Header().Refs() {
+		res, ok := reader.results[ref.Name()]
+		if !ok {
+			reader.results[ref.Name()] = &ARGresult{
+				Ref:         ref.Name(),
+				Length:      ref.Len(),
+				SampleReads: make(map[string]uint64),
+				coverage:    make([]uint32, ref.Len()),
+			}
+			continue
+		}
+		if len(res.coverage) != ref.Len() {
+			return fmt.Errorf("reference %v has mismatched lengths across BAM files", ref.Name())
+		}
+	}
+
+	for {
+		record, err := bamReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if record.Ref == nil {
+			continue
+		}
+		res := reader.results[record.Ref.Name()]
+		res.Reads++
+		res.SampleReads[sample]++
+		start, end := record.Start(), record.End()
+		for pos := start; pos < end && pos < len(res.coverage); pos++ {
+			if pos < 0 {
+				continue
+			}
+			res.coverage[pos]++
+		}
+	}
+	return nil
+}
+
+/*
+  A function to derive a sample name from a BAM file path: its base name
+  with the .bam extension stripped, so a wide report's per-sample columns
+  read like sample identifiers rather than full file paths
+*/
+func sampleName(bamFile string) string {
+	base := bamFile
+	if idx := strings.LastIndexAny(base, "/\\"); idx != -1 {
+		base = base[idx+1:]
+	}
+	return strings.TrimSuffix(base, ".bam")
+}
@@ -0,0 +1,164 @@
+package reporting
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/will-rowe/AReD/src/graph"
+)
+
+// test that sampleName strips the directory and .bam extension
+func TestSampleName(t *testing.T) {
+	cases := map[string]string{
+		"sample1.bam":        "sample1",
+		"/data/bams/foo.bam": "foo",
+		"./relative/bar.bam": "bar",
+	}
+	for in, want := range cases {
+		if got := sampleName(in); got != want {
+			t.Fatalf("sampleName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// test that writeTSV emits one reads column per sample, alongside the
+// merged total
+func TestWriteTSVPerSampleColumns(t *testing.T) {
+	reader := NewBAMreader()
+	reader.samples = []string{"sampleA", "sampleB"}
+	reader.results = map[string]*ARGresult{
+		"refA": {
+			Ref:         "refA",
+			Length:      100,
+			Reads:       30,
+			Breadth:     0.9,
+			MeanDepth:   2.0,
+			Evenness:    0.8,
+			SampleReads: map[string]uint64{"sampleA": 10, "sampleB": 20},
+		},
+	}
+
+	old := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	err = reader.writeTSV([]string{"refA"})
+	w.Close()
+	os.Stdout = old
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := io.ReadAll(bufio.NewReader(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a header and one row, got %d lines: %v", len(lines), lines)
+	}
+	header := strings.Split(lines[0], "\t")
+	wantHeader := []string{"ARG", "length", "reads:sampleA", "reads:sampleB", "reads", "breadth", "meanDepth", "evenness"}
+	if len(header) != len(wantHeader) {
+		t.Fatalf("header = %v, want %v", header, wantHeader)
+	}
+	for i := range wantHeader {
+		if header[i] != wantHeader[i] {
+			t.Fatalf("header = %v, want %v", header, wantHeader)
+		}
+	}
+	row := strings.Split(lines[1], "\t")
+	if row[2] != "10" || row[3] != "20" || row[4] != "30" {
+		t.Fatalf("unexpected per-sample/total reads columns: %v", row)
+	}
+}
+
+// test that a reference covered evenly at a single depth scores full
+// breadth and evenness, while one with depth piled onto a single base
+// scores a lower evenness for the same breadth
+func TestARGresultFinalise(t *testing.T) {
+	even := &ARGresult{Length: 4, coverage: []uint32{2, 2, 2, 2}}
+	even.finalise()
+	if even.Breadth != 1.0 {
+		t.Fatalf("expected breadth 1.0, got %v", even.Breadth)
+	}
+	if even.MeanDepth != 2.0 {
+		t.Fatalf("expected mean depth 2.0, got %v", even.MeanDepth)
+	}
+	if even.Evenness < 0.999 {
+		t.Fatalf("expected near-perfect evenness, got %v", even.Evenness)
+	}
+
+	uneven := &ARGresult{Length: 4, coverage: []uint32{8, 0, 0, 0}}
+	uneven.finalise()
+	if uneven.Breadth != 0.25 {
+		t.Fatalf("expected breadth 0.25, got %v", uneven.Breadth)
+	}
+	if uneven.Evenness >= even.Evenness {
+		t.Fatalf("expected uneven coverage to score lower evenness than even coverage, got %v >= %v", uneven.Evenness, even.Evenness)
+	}
+}
+
+// test that EMResolver.Resolve can let a member with far fewer raw reads
+// win a cluster, as long as its coverage profile (breadth * evenness)
+// backs it up far better than a high-read-count member whose coverage is
+// patchy and uneven (the signature of absorbing another member's
+// multi-mapped reads). A resolver that just picks the highest read count,
+// without ever consulting the coverage profiles, cannot pass this.
+func TestEMResolverResolveUsesCoverageProfile(t *testing.T) {
+	store := make(graph.GraphStore)
+	store[0] = &graph.GrootGraph{
+		GraphID: 0,
+		Paths: map[uint32][]byte{
+			0: []byte("wellSupported"),
+			1: []byte("manyReadsPatchy"),
+		},
+	}
+	resolver := NewEMResolver(store)
+
+	results := map[string]*ARGresult{
+		"wellSupported":   {Ref: "wellSupported", Reads: 3, Breadth: 0.99, Evenness: 0.95},
+		"manyReadsPatchy": {Ref: "manyReadsPatchy", Reads: 100, Breadth: 0.05, Evenness: 0.02},
+	}
+	resolver.Resolve(results)
+
+	if results["wellSupported"].Reads == 0 {
+		t.Fatal("expected the member with the far better coverage profile to win despite fewer raw reads")
+	}
+	if results["manyReadsPatchy"].Reads != 0 {
+		t.Fatal("expected the high-read, low-quality-coverage member to be zeroed out")
+	}
+}
+
+// test that EMResolver.Resolve collapses a cluster down to its single
+// highest-abundance member, zeroing out the rest, when coverage profiles
+// are comparable and read count is the only distinguishing signal
+func TestEMResolverResolve(t *testing.T) {
+	store := make(graph.GraphStore)
+	store[0] = &graph.GrootGraph{
+		GraphID: 0,
+		Paths: map[uint32][]byte{
+			0: []byte("refA"),
+			1: []byte("refB"),
+		},
+	}
+	resolver := NewEMResolver(store)
+
+	results := map[string]*ARGresult{
+		"refA": {Ref: "refA", Reads: 100, Breadth: 0.95, Evenness: 0.9},
+		"refB": {Ref: "refB", Reads: 5, Breadth: 0.95, Evenness: 0.9},
+	}
+	resolver.Resolve(results)
+
+	if results["refA"].Reads == 0 {
+		t.Fatal("expected the dominant cluster member to keep its reads")
+	}
+	if results["refB"].Reads != 0 {
+		t.Fatal("expected the minor cluster member to be zeroed out")
+	}
+}